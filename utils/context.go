@@ -0,0 +1,277 @@
+package utils
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/qor/qor"
+)
+
+// contextKey is an unexported type for the keys utils stashes on a request's
+// context.Context, so they can never collide with keys other packages set
+// with the same string (the stdlib's documented context.WithValue footgun).
+type contextKey string
+
+// requestIDContextKey is the context.Context key Middleware stores the
+// request ID under.
+const requestIDContextKey contextKey = "request_id"
+
+// timezoneContextKey is the context.Context key locationFromContext reads a
+// per-request timezone from.
+const timezoneContextKey contextKey = "timezone"
+
+// Middleware stamps every request with an `X-Request-ID`, propagating one
+// from the incoming request if present, otherwise generating a new one, and
+// stashes it on the request's context so utils.RequestID can retrieve it.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" {
+			requestID = generateRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", requestID)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDContextKey, requestID))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequestID returns the request ID stashed on context by Middleware, or ""
+// if none is present (e.g. Middleware wasn't used).
+func RequestID(context *qor.Context) string {
+	if context == nil || context.Request == nil {
+		return ""
+	}
+
+	if id, ok := context.Request.Context().Value(requestIDContextKey).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// generateRequestID returns a random UUID (v4) string, falling back to a
+// hex-encoded timestamp if the system RNG is unavailable.
+func generateRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return hex.EncodeToString([]byte(time.Now().Format(time.RFC3339Nano)))
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return hex.EncodeToString(b[0:4]) + "-" + hex.EncodeToString(b[4:6]) + "-" +
+		hex.EncodeToString(b[6:8]) + "-" + hex.EncodeToString(b[8:10]) + "-" + hex.EncodeToString(b[10:16])
+}
+
+// Flash is a single flash message queued with AddFlash.
+type Flash struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// FlashSigningKey signs the "_flashes" cookie so clients can't forge flash
+// messages. It defaults to a key randomly generated at process start, which
+// signs real flashes just fine but won't verify across restarts or between
+// instances behind a load balancer — apps running more than one instance
+// must override it with a shared secret.
+//     utils.FlashSigningKey = []byte(os.Getenv("FLASH_SIGNING_KEY"))
+var FlashSigningKey = generateFlashSigningKey()
+
+// generateFlashSigningKey returns a random 32-byte key, falling back to a
+// timestamp-derived key if the system RNG is unavailable.
+func generateFlashSigningKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return []byte(time.Now().Format(time.RFC3339Nano))
+	}
+	return key
+}
+
+const flashesCookieName = "_flashes"
+
+// AddFlash queues a flash message of the given level ("notice", "error",
+// ...) to be shown on the next request that calls Flashes, round-tripped
+// through a signed, HttpOnly cookie (see SetCookie). Flashes already staged
+// on the response by an earlier AddFlash call in the same request are read
+// back and merged in, rather than overwritten, so several flashes can be
+// queued before the response is written.
+func AddFlash(context *qor.Context, level string, msg string) {
+	flashes := append(pendingFlashes(context), Flash{Level: level, Message: msg})
+
+	encoded, err := encodeFlashes(flashes)
+	if err != nil {
+		return
+	}
+
+	discardStagedCookie(context, flashesCookieName)
+	SetCookie(http.Cookie{Name: flashesCookieName, Value: encoded, Expires: time.Now().Add(24 * time.Hour)}, context)
+}
+
+// Flashes returns the flash messages queued for this request and clears
+// them, so each flash message is shown exactly once.
+func Flashes(context *qor.Context) []Flash {
+	flashes := readFlashes(context)
+	if len(flashes) == 0 {
+		return flashes
+	}
+
+	// A cookie staged by AddFlash earlier in this request holds the incoming
+	// flashes followed by the new ones; keep only the new ones.
+	staged := pendingFlashes(context)
+	discardStagedCookie(context, flashesCookieName)
+	if len(staged) > len(flashes) {
+		if encoded, err := encodeFlashes(staged[len(flashes):]); err == nil {
+			SetCookie(http.Cookie{Name: flashesCookieName, Value: encoded, Expires: time.Now().Add(24 * time.Hour)}, context)
+			return flashes
+		}
+	}
+
+	SetCookie(http.Cookie{Name: flashesCookieName, Value: "", Expires: time.Now().Add(-time.Hour)}, context)
+	return flashes
+}
+
+func readFlashes(context *qor.Context) []Flash {
+	if context == nil || context.Request == nil {
+		return nil
+	}
+
+	cookie, err := context.Request.Cookie(flashesCookieName)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+
+	return decodeFlashes(cookie.Value)
+}
+
+// pendingFlashes returns the flashes that would be seen by Flashes if the
+// response were sent right now: those already on the incoming request's
+// cookie, plus any an earlier AddFlash in this same request has already
+// staged on the response writer.
+func pendingFlashes(context *qor.Context) []Flash {
+	if context != nil && context.Writer != nil {
+		for _, raw := range context.Writer.Header()["Set-Cookie"] {
+			if name, value, ok := parseCookieNameValue(raw); ok && name == flashesCookieName {
+				return decodeFlashes(value)
+			}
+		}
+	}
+
+	return readFlashes(context)
+}
+
+// discardStagedCookie removes any Set-Cookie header already staged for
+// `name` on context's response, leaving every other staged cookie intact.
+func discardStagedCookie(context *qor.Context, name string) {
+	if context == nil || context.Writer == nil {
+		return
+	}
+
+	header := context.Writer.Header()
+	staged := header["Set-Cookie"]
+	if len(staged) == 0 {
+		return
+	}
+
+	kept := staged[:0]
+	for _, raw := range staged {
+		if cookieName, _, ok := parseCookieNameValue(raw); ok && cookieName == name {
+			continue
+		}
+		kept = append(kept, raw)
+	}
+	header["Set-Cookie"] = kept
+}
+
+// parseCookieNameValue extracts the `name=value` pair from the front of a
+// raw Set-Cookie header, ignoring the attributes (Path, Expires, ...) that
+// follow the first semicolon.
+func parseCookieNameValue(raw string) (name string, value string, ok bool) {
+	nameValue := strings.SplitN(raw, ";", 2)[0]
+	parts := strings.SplitN(nameValue, "=", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+
+	return strings.TrimSpace(parts[0]), parts[1], true
+}
+
+func encodeFlashes(flashes []Flash) (string, error) {
+	data, err := json.Marshal(flashes)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.URLEncoding.EncodeToString(data)
+	return encoded + "." + signFlashes(encoded), nil
+}
+
+func decodeFlashes(value string) []Flash {
+	parts := strings.SplitN(value, ".", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+
+	encoded, signature := parts[0], parts[1]
+	if !hmac.Equal([]byte(signFlashes(encoded)), []byte(signature)) {
+		return nil
+	}
+
+	data, err := base64.URLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil
+	}
+
+	var flashes []Flash
+	if err := json.Unmarshal(data, &flashes); err != nil {
+		return nil
+	}
+	return flashes
+}
+
+func signFlashes(encoded string) string {
+	mac := hmac.New(sha256.New, FlashSigningKey)
+	mac.Write([]byte(encoded))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// JSON writes `payload` to context's response as a JSON envelope carrying
+// the request ID, e.g. `{"request_id": "...", "data": ...}`. Values that
+// don't marshal to JSON on their own (e.g. model instances) are run through
+// Stringify first.
+func JSON(context *qor.Context, status int, payload interface{}) {
+	writeJSON(context, status, map[string]interface{}{
+		"request_id": RequestID(context),
+		"data":       jsonSafe(payload),
+	})
+}
+
+// Error writes `msg` to context's response as a JSON error envelope, e.g.
+// `{"request_id": "...", "error": "..."}`.
+func Error(context *qor.Context, status int, msg string) {
+	writeJSON(context, status, map[string]interface{}{
+		"request_id": RequestID(context),
+		"error":      msg,
+	})
+}
+
+func writeJSON(context *qor.Context, status int, envelope interface{}) {
+	context.Writer.Header().Set("Content-Type", "application/json")
+	context.Writer.WriteHeader(status)
+	json.NewEncoder(context.Writer).Encode(envelope)
+}
+
+func jsonSafe(payload interface{}) interface{} {
+	if _, err := json.Marshal(payload); err == nil {
+		return payload
+	}
+	return Stringify(payload)
+}
@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/qor/qor"
+)
+
+// DefaultLocale is used when a requested locale (or one of its fallbacks) has
+// no catalog loaded
+var DefaultLocale = "en-US"
+
+var (
+	translationsMutex sync.RWMutex
+	// translations is seeded with a minimal built-in English catalog so
+	// helpers like FormatTimeRelative produce real text before an app has
+	// called InitTranslations. Loading a `<DefaultLocale>.json` file merges
+	// into, rather than replacing, this catalog.
+	translations = map[string]map[string]string{
+		"en-US": {
+			"time.ago":      "{{.Count}} {{.Unit}} ago",
+			"time.from_now": "in {{.Count}} {{.Unit}}",
+		},
+	}
+)
+
+// InitTranslations walks `dir` and loads every `<locale>.json` file found
+// there into the translation catalogs. Each file is expected to be a flat
+// `key -> template` map, e.g.:
+//
+//     {"welcome": "Hello, {{.Name}}!"}
+//
+// The locale name is taken from the file name without its extension, so
+// `zh-CN.json` is loaded as the `zh-CN` catalog.
+func InitTranslations(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		locale := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
+
+		bytes, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return err
+		}
+
+		var catalog map[string]string
+		if err := json.Unmarshal(bytes, &catalog); err != nil {
+			return err
+		}
+
+		translationsMutex.Lock()
+		if existing, ok := translations[locale]; ok {
+			for key, value := range catalog {
+				existing[key] = value
+			}
+		} else {
+			translations[locale] = catalog
+		}
+		translationsMutex.Unlock()
+	}
+
+	return nil
+}
+
+// Translations returns the catalog loaded for `locale`, falling back to the
+// primary subtag (e.g. `en-GB` -> `en`) and then to `DefaultLocale` when the
+// requested locale has no catalog of its own.
+func Translations(locale string) map[string]string {
+	translationsMutex.RLock()
+	defer translationsMutex.RUnlock()
+
+	for _, candidate := range localeFallbackChain(locale) {
+		if catalog, ok := translations[candidate]; ok {
+			return catalog
+		}
+	}
+
+	return nil
+}
+
+// hasCatalog reports whether `locale` has an exact-match catalog loaded,
+// without walking localeFallbackChain. GetLocale uses this (rather than
+// Translations) to negotiate Accept-Language, since Translations' fallback
+// to DefaultLocale would otherwise make it match every tag.
+func hasCatalog(locale string) bool {
+	translationsMutex.RLock()
+	defer translationsMutex.RUnlock()
+
+	_, ok := translations[locale]
+	return ok
+}
+
+// localeFallbackChain returns `locale`, its primary subtag, and DefaultLocale,
+// in the order they should be tried, skipping duplicates.
+func localeFallbackChain(locale string) []string {
+	var chain []string
+	seen := map[string]bool{}
+
+	add := func(l string) {
+		if l != "" && !seen[l] {
+			seen[l] = true
+			chain = append(chain, l)
+		}
+	}
+
+	add(locale)
+	if idx := strings.IndexAny(locale, "-_"); idx > 0 {
+		add(locale[:idx])
+	}
+	add(DefaultLocale)
+
+	return chain
+}
+
+// T returns a translation function scoped to the locale negotiated for
+// `context` (via GetLocale). The returned function looks up `key` in the
+// locale's catalog, falling back through localeFallbackChain, and executes
+// it as a `text/template` with `args` treated as alternating key/value
+// pairs, e.g. `t("welcome", "Name", "Jane")`. When no catalog has `key`, the
+// key itself is returned unchanged.
+//
+// Overwrite the default logic with
+//     utils.T = func(context *qor.Context) func(string, ...interface{}) string {
+//         // ....
+//     }
+var T = func(context *qor.Context) func(key string, args ...interface{}) string {
+	locale := GetLocale(context)
+
+	return func(key string, args ...interface{}) string {
+		var tmpl string
+		found := false
+		translationsMutex.RLock()
+		for _, candidate := range localeFallbackChain(locale) {
+			if tmpl, found = translations[candidate][key]; found {
+				break
+			}
+		}
+		translationsMutex.RUnlock()
+		if !found {
+			return key
+		}
+
+		data := map[string]interface{}{}
+		for i := 0; i+1 < len(args); i += 2 {
+			if name, ok := args[i].(string); ok {
+				data[name] = args[i+1]
+			}
+		}
+
+		t, err := template.New(key).Parse(tmpl)
+		if err != nil {
+			return tmpl
+		}
+
+		var buf strings.Builder
+		if err := t.Execute(&buf, data); err != nil {
+			return tmpl
+		}
+
+		return buf.String()
+	}
+}
+
+// parseAcceptLanguage parses an `Accept-Language` header value into its
+// language tags, sorted by descending quality (`q`) value.
+func parseAcceptLanguage(header string) []string {
+	type weightedTag struct {
+		tag    string
+		weight float64
+	}
+
+	var tags []weightedTag
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		weight := 1.0
+		tag := part
+		if idx := strings.Index(part, ";"); idx != -1 {
+			tag = strings.TrimSpace(part[:idx])
+			if q := strings.TrimSpace(part[idx+1:]); strings.HasPrefix(q, "q=") {
+				if parsed, err := strconv.ParseFloat(strings.TrimPrefix(q, "q="), 64); err == nil {
+					weight = parsed
+				}
+			}
+		}
+
+		if tag != "" {
+			tags = append(tags, weightedTag{tag: tag, weight: weight})
+		}
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].weight > tags[j].weight })
+
+	results := make([]string, len(tags))
+	for i, t := range tags {
+		results[i] = t.tag
+	}
+	return results
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/qor/qor"
+)
+
+// Field is a single structured key/value pair attached to a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger is the logging interface used throughout qor. Swap the default
+// stdlib-backed implementation for zap, logrus, slog, etc. with:
+//     utils.Log = myLogger{}
+type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+	// WithContext returns a Logger that attaches context's request ID (see
+	// Middleware/RequestID) to every entry it logs.
+	WithContext(context *qor.Context) Logger
+}
+
+// Log is the package-level logger used by ExitWithMsg.
+// Overwrite it with
+//     utils.Log = myLogger{}
+var Log Logger = newStdLogger(os.Stderr)
+
+type stdLogger struct {
+	logger    *log.Logger
+	requestID string
+}
+
+func newStdLogger(out *os.File) *stdLogger {
+	return &stdLogger{logger: log.New(out, "", log.LstdFlags)}
+}
+
+func (l *stdLogger) Debug(msg string, fields ...Field) { l.write("DEBUG", msg, fields) }
+func (l *stdLogger) Info(msg string, fields ...Field)  { l.write("INFO", msg, fields) }
+func (l *stdLogger) Warn(msg string, fields ...Field)  { l.write("WARN", msg, fields) }
+func (l *stdLogger) Error(msg string, fields ...Field) { l.write("ERROR", msg, fields) }
+
+func (l *stdLogger) WithContext(context *qor.Context) Logger {
+	return &stdLogger{logger: l.logger, requestID: RequestID(context)}
+}
+
+func (l *stdLogger) write(level string, msg string, fields []Field) {
+	if l.requestID != "" {
+		fields = append([]Field{{Key: "request_id", Value: l.requestID}}, fields...)
+	}
+
+	var b strings.Builder
+	b.WriteString(level)
+	b.WriteString(": ")
+	b.WriteString(msg)
+	for _, field := range fields {
+		fmt.Fprintf(&b, " %s=%v", field.Key, field.Value)
+	}
+
+	l.logger.Println(b.String())
+}
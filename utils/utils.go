@@ -5,10 +5,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
-	"os"
 	"reflect"
 	"runtime"
-	"runtime/debug"
 	"time"
 
 	"github.com/jinzhu/gorm"
@@ -146,32 +144,56 @@ func ParseTagOption(str string) map[string]string {
 	return setting
 }
 
-// ExitWithMsg debug error messages and print stack
+// ExitWithMsg debug error messages, logging them (with a structured stack
+// field) through Log instead of dumping a stack trace to stdout. When one of
+// `value` is a *qor.Context, its request ID (see Middleware/RequestID) is
+// attached to the log entry.
 func ExitWithMsg(msg interface{}, value ...interface{}) {
-	fmt.Printf("\n"+filenameWithLineNum()+"\n"+fmt.Sprint(msg)+"\n", value...)
-	debug.PrintStack()
-}
-
-func filenameWithLineNum() string {
-	var total = 10
-	var results []string
-	for i := 2; i < 15; i++ {
-		if _, file, line, ok := runtime.Caller(i); ok {
-			total--
-			results = append(results[:0],
-				append(
-					[]string{fmt.Sprintf("%v:%v", strings.TrimPrefix(file, os.Getenv("GOPATH")+"src/"), line)},
-					results[0:]...)...)
-
-			if total == 0 {
-				return strings.Join(results, "\n")
-			}
+	logger := Log
+	formatArgs := make([]interface{}, 0, len(value))
+	for _, v := range value {
+		if ctx, ok := v.(*qor.Context); ok {
+			logger = logger.WithContext(ctx)
+			continue
 		}
+		formatArgs = append(formatArgs, v)
 	}
-	return ""
+
+	logger.Error(fmt.Sprintf(fmt.Sprint(msg), formatArgs...), Field{Key: "stack", Value: formatFrames(callerFrames())})
+}
+
+// callerFrames returns the stack frames leading up to the call to
+// ExitWithMsg, innermost first, so callers can format them however they like.
+func callerFrames() []runtime.Frame {
+	pcs := make([]uintptr, 10)
+	n := runtime.Callers(3, pcs)
+
+	framesIter := runtime.CallersFrames(pcs[:n])
+	var frames []runtime.Frame
+	for {
+		frame, more := framesIter.Next()
+		frames = append(frames, frame)
+		if !more {
+			break
+		}
+	}
+	return frames
+}
+
+// formatFrames renders frames as a newline-joined "file:line" stack.
+func formatFrames(frames []runtime.Frame) string {
+	lines := make([]string, len(frames))
+	for i, frame := range frames {
+		lines[i] = fmt.Sprintf("%v:%v", frame.File, frame.Line)
+	}
+	return strings.Join(lines, "\n")
 }
 
-// GetLocale get locale from request, cookie, after get the locale, will write the locale to the cookie if possible
+// GetLocale get locale from request, cookie, after get the locale, will write the locale to the cookie if possible.
+// When none of the `Locale` header, `locale` query param or `locale` cookie are
+// set, it falls back to negotiating a locale from the standard
+// `Accept-Language` header, picking the highest `q`-weighted tag (or its
+// primary subtag) that has a loaded translation catalog.
 // Overwrite the default logic with
 //     utils.GetLocale = func(context *qor.Context) string {
 //         // ....
@@ -193,23 +215,132 @@ var GetLocale = func(context *qor.Context) string {
 		return locale.Value
 	}
 
+	if header := context.Request.Header.Get("Accept-Language"); header != "" {
+		for _, tag := range parseAcceptLanguage(header) {
+			if hasCatalog(tag) {
+				return tag
+			}
+
+			if idx := strings.IndexAny(tag, "-_"); idx > 0 {
+				if primary := tag[:idx]; hasCatalog(primary) {
+					return primary
+				}
+			}
+		}
+	}
+
 	return ""
 }
 
-// ParseTime parse time from string
+// TimeFormats is the list of layouts the default ParseTime tries, in order,
+// before falling back to `now.Parse`. Apps can append locale-specific layouts to this slice.
+var TimeFormats = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"01/02/2006 15:04:05",
+	"02/01/2006 15:04:05",
+	"2006-01-02",
+	"01/02/2006",
+	"02/01/2006",
+}
+
+// DefaultLocation is used to resolve a time.Location for a request when it
+// carries neither a "timezone" context value nor a "tz" cookie.
+var DefaultLocation = time.UTC
+
+// locationFromContext resolves the *time.Location to use for `context`,
+// checking a per-request "timezone" context value, then a "tz" cookie, then
+// falling back to DefaultLocation.
+func locationFromContext(context *qor.Context) *time.Location {
+	if context != nil && context.Request != nil {
+		value := context.Request.Context().Value(timezoneContextKey)
+		if value == nil {
+			value = context.Request.Context().Value("timezone")
+		}
+
+		switch tz := value.(type) {
+		case *time.Location:
+			if tz != nil {
+				return tz
+			}
+		case string:
+			if loc, err := time.LoadLocation(tz); err == nil {
+				return loc
+			}
+		}
+
+		if cookie, err := context.Request.Cookie("tz"); err == nil && cookie.Value != "" {
+			if loc, err := time.LoadLocation(cookie.Value); err == nil {
+				return loc
+			}
+		}
+	}
+
+	return DefaultLocation
+}
+
+// ParseTime parse time from string, trying each layout in TimeFormats, in
+// order, in the location resolved for `context` (see locationFromContext).
+// Falls back to `now.Parse` when no registered layout matches.
 // Overwrite the default logic with
 //     utils.ParseTime = func(timeStr string, context *qor.Context) (time.Time, error) {
 //         // ....
 //     }
 var ParseTime = func(timeStr string, context *qor.Context) (time.Time, error) {
+	loc := locationFromContext(context)
+
+	for _, layout := range TimeFormats {
+		if t, err := time.ParseInLocation(layout, timeStr, loc); err == nil {
+			return t, nil
+		}
+	}
+
 	return now.Parse(timeStr)
 }
 
-// FormatTime format time to string
+// FormatTime format time to string, in the location resolved for `context`
+// (see locationFromContext).
 // Overwrite the default logic with
 //     utils.FormatTime = func(time time.Time, format string, context *qor.Context) string {
 //         // ....
 //     }
 var FormatTime = func(date time.Time, format string, context *qor.Context) string {
-	return date.Format(format)
+	return date.In(locationFromContext(context)).Format(format)
+}
+
+// FormatTimeRelative formats `t` relative to now (resolved in context's
+// location) as a human string, e.g. "3 minutes ago" or "in 2 days",
+// translated through utils.T so locale catalogs can override the wording
+// with the "time.ago"/"time.from_now" keys.
+func FormatTimeRelative(t time.Time, context *qor.Context) string {
+	loc := locationFromContext(context)
+	diff := time.Now().In(loc).Sub(t.In(loc))
+
+	future := diff < 0
+	if future {
+		diff = -diff
+	}
+
+	unit, count := relativeUnit(diff)
+	t2 := T(context)
+
+	if future {
+		return t2("time.from_now", "Unit", unit, "Count", count)
+	}
+	return t2("time.ago", "Unit", unit, "Count", count)
+}
+
+// relativeUnit picks the largest whole unit ("seconds", "minutes", "hours",
+// "days") that fits `diff`, along with its count.
+func relativeUnit(diff time.Duration) (unit string, count int) {
+	switch {
+	case diff < time.Minute:
+		return "seconds", int(diff / time.Second)
+	case diff < time.Hour:
+		return "minutes", int(diff / time.Minute)
+	case diff < 24*time.Hour:
+		return "hours", int(diff / time.Hour)
+	default:
+		return "days", int(diff / (24 * time.Hour))
+	}
 }